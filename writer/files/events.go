@@ -0,0 +1,47 @@
+package fileout
+
+import "time"
+
+// EventHandler receives notifications about the rotation lifecycle. It's a
+// supported hook for wiring rotation into Prometheus metrics or shipping a
+// "rotated" notification to a downstream log ingest pipeline, replacing the
+// single-purpose stuffunc.
+type EventHandler interface {
+	// OnRotate is called once prev is closed and next becomes the active
+	// file. prev is empty on the very first file created, and on the first
+	// file created after a timer-driven rotation closed the previous file
+	// without opening a new one.
+	//
+	// Delivery is best-effort: it's dispatched through a depth-1 channel
+	// drained by the same goroutine that does purge/compress work, and a
+	// rotation that arrives while that goroutine is busy (or while a prior
+	// OnRotate is still queued) is dropped after a 10ms wait rather than
+	// blocking Write. Stats().Rotations always increments, so use it (not
+	// OnRotate) if you need an exact count; rely on OnRotate only for
+	// non-critical notifications like shipping a "rotated" event downstream.
+	OnRotate(prev, next string)
+	// OnPurge is called once a rotated file is deleted, whether by maxAge,
+	// maxBackups, or a RotateRule's OutdatedFiles.
+	OnPurge(path string)
+	// OnCompress is called once path has been compressed into path+".gz"
+	// and path removed; ratio is compressed-size/original-size. It is not
+	// called when the source file was empty.
+	OnCompress(path string, ratio float64)
+}
+
+// Stats reports cumulative counters maintained since the fileout was
+// created.
+type Stats struct {
+	BytesWritten  int64
+	Rotations     int64
+	Purges        int64
+	LastRotatedAt time.Time
+}
+
+// rotateEvent carries an OnRotate notification from getWriter (called under
+// mu) to stduffRun's goroutine, which dispatches it to EventHandler outside
+// of mu so a handler calling back into Stats()/RuningInfo() can't
+// self-deadlock.
+type rotateEvent struct {
+	prev, next string
+}
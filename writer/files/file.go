@@ -2,18 +2,22 @@ package fileout
 
 import (
 	"bufio"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"io/fs"
-	"io/ioutil"
+	"log"
 	"logs-go/strftime"
 	"logs-go/utils"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,14 +26,16 @@ const (
 	defaultBufSize = 4
 	randnum        = 10
 	templog        = ".tmp"
+	gzipSuffix     = ".gz"
+
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
 )
 
 var (
 	// log start time
 	currentTime = time.Now
 
-	// os_Stat exists so it can be mocked out by tests.
-	os_Stat = os.Stat
 	// to file_log mb.
 	megabyte = 1024 * 1024
 	// avoid duplicate files
@@ -94,6 +100,63 @@ func WithStuffunc(t time.Duration) Option {
 	}
 }
 
+// WithCompression sets the algorithm used to compress a rotated file once
+// its .tmp is finalized. Only "gzip" is implemented; NewFileout returns an
+// error for "zstd" and for any other unknown algorithm.
+func WithCompression(algo string) Option {
+	return func(o *Options) {
+		o.compression = algo
+	}
+}
+
+// WithRotateRule overrides the trigger getWriter consults to decide when to
+// rotate, letting callers compose custom triggers (e.g. rotate on SIGHUP,
+// or on an external signal) without patching fileout. WithMaxSize and
+// WithRotationTime are ignored once a RotateRule is supplied explicitly.
+func WithRotateRule(rule RotateRule) Option {
+	return func(o *Options) {
+		o.rotateRule = rule
+	}
+}
+
+// WithLinkName mirrors lestrrat file-rotatelogs: after every rotation the
+// symlink at path is repointed at the newly active log file, so operators
+// can tail a stable path (e.g. "/var/log/app/current.log") regardless of
+// the strftime-derived filename or generation suffix.
+func WithLinkName(path string) Option {
+	return func(o *Options) {
+		o.linkName = path
+	}
+}
+
+// WithMaxBackups caps the number of retained rotated files at n, in
+// addition to maxAge: once more than n files match the glob pattern
+// (excluding the currently open .tmp), the oldest by modtime are deleted
+// first (FIFO). Use this to bound disk usage after a burst of small
+// rotations that maxAge alone wouldn't catch in time.
+func WithMaxBackups(n int) Option {
+	return func(o *Options) {
+		o.maxBackups = n
+	}
+}
+
+// WithEventHandler registers h to be notified of rotation lifecycle events
+// (rotate, purge, compress) from getWriter and stduffHandler.
+func WithEventHandler(h EventHandler) Option {
+	return func(o *Options) {
+		o.eventHandler = h
+	}
+}
+
+// WithFS overrides the filesystem backend fileout reads and writes through,
+// in place of the default osFS. Use this for in-memory testing or a
+// non-local backend without forking.
+func WithFS(fs FS) Option {
+	return func(o *Options) {
+		o.fs = fs
+	}
+}
+
 type Options struct {
 	// filename generation rule
 	gtr string
@@ -109,6 +172,19 @@ type Options struct {
 	requriedTimezone bool
 	// handler stuff files
 	stuffunc func(fullPathName string)
+	// compression algorithm applied to files once rotated, "" disables it
+	compression string
+	// rotateRule decides when to rotate; set to defaultRotateRule(...) when
+	// WithRotateRule isn't supplied
+	rotateRule RotateRule
+	// linkName, when set, is kept pointed at the active log file
+	linkName string
+	// maxBackups caps the number of retained rotated files, 0 disables it
+	maxBackups int
+	// eventHandler, when set, is notified of rotate/purge/compress events
+	eventHandler EventHandler
+	// fs is the filesystem backend, defaults to osFS
+	fs FS
 }
 
 func NewFileout(name string, opts ...Option) (*fileout, error) {
@@ -121,11 +197,36 @@ func NewFileout(name string, opts ...Option) (*fileout, error) {
 		return nil, fmt.Errorf("time format invalid %s", err)
 	}
 
+	switch o.compression {
+	case "":
+	case compressionGzip:
+		// compression is accepted only when a rotation boundary is set
+		// explicitly; the 100MB default maxSize alone doesn't count.
+		if o.maxSize <= 0 && o.rotationTime <= 0 {
+			return nil, fmt.Errorf("compression requires WithMaxSize or WithRotationTime to be set")
+		}
+	case compressionZstd:
+		return nil, fmt.Errorf("compression algorithm %q is not implemented yet", o.compression)
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm %q", o.compression)
+	}
+
 	match := name
 	for _, re := range patternConversionRegexps {
 		match = re.ReplaceAllString(match, "*") + "*"
 	}
 
+	if o.fs == nil {
+		o.fs = osFS{}
+	}
+
+	// o.fs must be set before building the default rule, since its
+	// OutdatedFiles() reads through o.fs to stay consistent with the purge
+	// path in stduffHandler.
+	if o.rotateRule == nil {
+		o.rotateRule = defaultRotateRule(match, o)
+	}
+
 	return &fileout{
 		opt:   o,
 		strf:  strf,
@@ -144,7 +245,7 @@ type fileout struct {
 
 	w *bufio.Writer
 
-	fr *os.File
+	fr File
 
 	size int64
 
@@ -153,8 +254,17 @@ type fileout struct {
 	generation int
 	// handler age and log file
 	oldStuff chan string
+	// rotate notifications, drained by stduffRun outside of mu
+	rotateEvents chan rotateEvent
 
 	startMill sync.Once
+
+	// cumulative counters backing Stats(), kept atomic since stduffRun's
+	// goroutine updates them outside of mu
+	bytesWritten int64
+	rotations    int64
+	purges       int64
+	lastRotateNS int64
 }
 
 func (l *fileout) test() int {
@@ -191,14 +301,6 @@ func (l *fileout) rotationTime() time.Duration {
 	return l.opt.rotationTime * time.Minute
 }
 
-// maxAge
-func (l *fileout) maxAge() time.Duration {
-	if l.opt.maxAge > 0 {
-		return time.Duration(l.opt.maxAge) * 24 * time.Hour
-	}
-	return 24 * 365 * time.Hour
-}
-
 // Sync
 func (d *fileout) Sync() error {
 	d.mu.Lock()
@@ -243,8 +345,11 @@ func (d *fileout) getWriter(b []byte, createFile bool) (io.Writer, error) {
 	writeLen := int64(len(b))
 
 	var forceNewFile bool
-	// create new file
-	if d.fr == nil || (d.size+writeLen) > d.maxSize() || (rotationtime > 0 && filename != d.fr.Name()) {
+	// create new file; the rotation trigger itself is fully owned by
+	// opt.rotateRule (defaulted from WithMaxSize/WithRotationTime in
+	// NewFileout), so a custom WithRotateRule can suppress size/time
+	// rotation entirely instead of only adding to it.
+	if d.fr == nil || d.opt.rotateRule.ShallRotate(d.size+writeLen, d.currTime) {
 		if (d.size + writeLen) > d.maxSize() {
 			// avoid duplicate files
 			d.generation++
@@ -253,11 +358,13 @@ func (d *fileout) getWriter(b []byte, createFile bool) (io.Writer, error) {
 	}
 
 	if forceNewFile {
+		d.opt.rotateRule.MarkRotated()
 		if gentime {
 			d.currTime = time.Now()
 		}
 		d.startMill.Do(func() {
 			d.oldStuff = make(chan string, 1)
+			d.rotateEvents = make(chan rotateEvent, 1)
 			go d.stduffRun()
 		})
 		select {
@@ -270,7 +377,7 @@ func (d *fileout) getWriter(b []byte, createFile bool) (io.Writer, error) {
 		}
 		for {
 			filename = utils.GenRolaFileName(d.strf, d.currTime, rotationtime, d.generation, d.opt.requriedTimezone, templog)
-			_, err := os_Stat(d.rename(filename))
+			_, err := d.opt.fs.Stat(d.rename(filename))
 			if err != nil {
 				break
 			}
@@ -287,6 +394,11 @@ func (d *fileout) getWriter(b []byte, createFile bool) (io.Writer, error) {
 		if err != nil {
 			return nil, err
 		}
+		var prevName string
+		if d.fr != nil {
+			prevName = d.fr.Name()
+		}
+		d.updateLink(filename)
 		d.close()
 		if d.w != nil {
 			d.w.Reset(nf)
@@ -295,6 +407,14 @@ func (d *fileout) getWriter(b []byte, createFile bool) (io.Writer, error) {
 		}
 		d.size = 0
 		d.fr = nf
+		atomic.AddInt64(&d.rotations, 1)
+		atomic.StoreInt64(&d.lastRotateNS, time.Now().UnixNano())
+		if d.opt.eventHandler != nil {
+			select {
+			case d.rotateEvents <- rotateEvent{prev: prevName, next: filename}:
+			case <-time.After(time.Millisecond * 10):
+			}
+		}
 	}
 	return d.w, nil
 }
@@ -307,6 +427,10 @@ func (d *fileout) stduffRun() {
 		select {
 		case stduff := <- d.oldStuff:
 			_ = d.stduffHandler(stduff)
+		case ev := <-d.rotateEvents:
+			if d.opt.eventHandler != nil {
+				d.opt.eventHandler.OnRotate(ev.prev, ev.next)
+			}
 		case <- tick:
 			if len(d.oldStuff) == 0 {
 				d.mu.Lock()
@@ -317,46 +441,170 @@ func (d *fileout) stduffRun() {
 	}
 }
 
-// stduffHandler rename/remove/callback old files
+// purge removes path and reports it through Stats()/OnPurge.
+func (d *fileout) purge(path string) {
+	if err := d.opt.fs.Remove(path); err != nil {
+		return
+	}
+	atomic.AddInt64(&d.purges, 1)
+	if d.opt.eventHandler != nil {
+		d.opt.eventHandler.OnPurge(path)
+	}
+}
+
+// stduffHandler rename/remove/compress/callback old files
 func (d *fileout) stduffHandler(stduff string) error {
-	matches, err := filepath.Glob(stduff)
+	// maxAge purging is owned by rotateRule.OutdatedFiles alone; it already
+	// globs stduff and drops anything older than maxAge, so the per-match
+	// loop below no longer re-checks age against a second reference time.
+	for _, outdated := range d.opt.rotateRule.OutdatedFiles() {
+		d.purge(outdated)
+	}
+
+	// stduff already ends in a "*" wildcard, which also matches the ".gz"
+	// suffix gzipped backups carry, so there's no need to glob for that
+	// suffix separately.
+	matches, err := d.opt.fs.Glob(stduff)
 	if err != nil {
 		return err
 	}
 	for _, fullName := range matches {
-		f, err := os.Stat(fullName)
+		f, err := d.opt.fs.Stat(fullName)
 		if err != nil {
 			continue
 		}
-		if d.currTime.Sub(f.ModTime()) > d.maxAge() {
-			os.Remove(fullName)
-			continue
-		}
 		if strings.HasSuffix(fullName, templog) {
 			if d.currTime.Sub(f.ModTime()) >= d.rotationTime()*2 || (f.Size()+2048) > d.maxSize() {
 				return d.renameFile(f.Name())
 			}
 		}
+		if d.opt.compression != "" && !strings.HasSuffix(fullName, templog) && !strings.HasSuffix(fullName, gzipSuffix) {
+			if err := d.compressFile(fullName); err != nil {
+				return err
+			}
+			continue
+		}
 		if d.opt.stuffunc != nil {
 			d.opt.stuffunc(fullName)
 		}
 	}
+
+	if d.opt.maxBackups > 0 {
+		if err := d.enforceMaxBackups(stduff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enforceMaxBackups caps the number of retained rotated files at
+// opt.maxBackups, deleting the oldest by modtime first (FIFO) once the
+// limit is exceeded; files with tied modtimes are evicted in the order
+// fs.Glob returned them.
+func (d *fileout) enforceMaxBackups(pattern string) error {
+	// pattern already ends in a "*" wildcard, which also matches the ".gz"
+	// suffix gzipped backups carry, so there's no need to glob for that
+	// suffix separately (doing so double-counted every .gz backup).
+	matches, err := d.opt.fs.Glob(pattern)
+	if err != nil {
+		return err
+	}
+
+	type backup struct {
+		name    string
+		modTime time.Time
+	}
+	var backups []backup
+	for _, fullName := range matches {
+		if strings.HasSuffix(fullName, templog) {
+			continue
+		}
+		fi, err := d.opt.fs.Stat(fullName)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name: fullName, modTime: fi.ModTime()})
+	}
+	if len(backups) <= d.opt.maxBackups {
+		return nil
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].modTime.Before(backups[j].modTime)
+	})
+	for _, b := range backups[:len(backups)-d.opt.maxBackups] {
+		d.purge(b.name)
+	}
 	return nil
 }
 
-// oldLogFiles
+// compressFile gzips fullName into fullName+".gz" and removes the source,
+// run from stduffRun's goroutine so it never blocks Write.
+func (d *fileout) compressFile(fullName string) error {
+	srcInfo, err := d.opt.fs.Stat(fullName)
+	if err != nil {
+		return err
+	}
+
+	src, err := d.opt.fs.OpenFile(fullName, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := d.opt.fs.OpenFile(fullName+gzipSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(dst)
+	if _, err := io.Copy(gw, src); err != nil {
+		gw.Close()
+		dst.Close()
+		d.opt.fs.Remove(fullName + gzipSuffix)
+		return fmt.Errorf("failed to compress %s: %s", fullName, err)
+	}
+	if err := gw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := d.opt.fs.Remove(fullName); err != nil {
+		return err
+	}
+
+	if d.opt.eventHandler != nil && srcInfo.Size() > 0 {
+		if gzInfo, err := d.opt.fs.Stat(fullName + gzipSuffix); err == nil {
+			d.opt.eventHandler.OnCompress(fullName, float64(gzInfo.Size())/float64(srcInfo.Size()))
+		}
+	}
+	return nil
+}
+
+// oldLogFiles lists the FileInfo for every file in stdff's directory,
+// routed through fs.Glob since FS has no ReadDir.
 func (d *fileout) oldLogFiles(stdff string) ([]fs.FileInfo, error) {
-	files, err := ioutil.ReadDir(stdff)
+	matches, err := d.opt.fs.Glob(filepath.Join(stdff, "*"))
 	if err != nil {
 		return nil, fmt.Errorf("can't read log file directory: %s", err)
 	}
+	files := make([]fs.FileInfo, 0, len(matches))
+	for _, m := range matches {
+		fi, err := d.opt.fs.Stat(m)
+		if err != nil {
+			continue
+		}
+		files = append(files, fi)
+	}
 	return files, nil
 }
 
 // renameFile
 func (d *fileout) renameFile(fullName string) error {
 	if na := d.rename(fullName); na != "" {
-		return os.Rename(fullName, na)
+		return d.opt.fs.Rename(fullName, na)
 	}
 	return nil
 }
@@ -392,16 +640,17 @@ func (d *fileout) Write(b []byte) (n int, err error) {
 	}
 	n, err = w.Write(b)
 	d.size += int64(n)
+	atomic.AddInt64(&d.bytesWritten, int64(n))
 	return n, err
 }
 
 // CreateFile creates a new file in the given path, creating parent directories
-func (d *fileout) createFile(filename string) (*os.File, error) {
+func (d *fileout) createFile(filename string) (File, error) {
 	dirname := filepath.Dir(filename)
-	if err := os.MkdirAll(dirname, 0755); err != nil {
+	if err := d.opt.fs.MkdirAll(dirname, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create directory %s", dirname)
 	}
-	fh, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	fh, err := d.opt.fs.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file %s: %s", filename, err)
 	}
@@ -409,6 +658,33 @@ func (d *fileout) createFile(filename string) (*os.File, error) {
 	return fh, nil
 }
 
+// updateLink atomically repoints opt.linkName at filename: write to
+// path.tmp, then rename over path, mirroring lestrrat file-rotatelogs.
+func (d *fileout) updateLink(filename string) {
+	if d.opt.linkName == "" {
+		return
+	}
+	if runtime.GOOS == "windows" {
+		log.Printf("fileout: symlink to %q skipped, not supported on windows", d.opt.linkName)
+		return
+	}
+
+	target := filename
+	if rel, err := filepath.Rel(filepath.Dir(d.opt.linkName), filename); err == nil && !strings.HasPrefix(rel, "..") {
+		target = rel
+	}
+
+	tmpLink := d.opt.linkName + templog
+	d.opt.fs.Remove(tmpLink)
+	if err := d.opt.fs.Symlink(target, tmpLink); err != nil {
+		log.Printf("fileout: failed to create symlink %q: %s", tmpLink, err)
+		return
+	}
+	if err := d.opt.fs.Rename(tmpLink, d.opt.linkName); err != nil {
+		log.Printf("fileout: failed to activate symlink %q: %s", d.opt.linkName, err)
+	}
+}
+
 func (d *fileout) RuningInfo() map[string]interface{} {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -416,9 +692,34 @@ func (d *fileout) RuningInfo() map[string]interface{} {
 	runing["bufSize"] = fmt.Sprintf("%.4fMB", float64(d.bufsize())/float64(megabyte))
 	runing["maxSize"] = fmt.Sprintf("%dMB", d.maxSize()/int64(megabyte))
 	runing["rotationTime"] = fmt.Sprintf("%ds", d.rotationTime())
+	runing["compression"] = d.opt.compression
+	runing["linkName"] = d.opt.linkName
+	runing["maxBackups"] = d.opt.maxBackups
 	runing["currentSize"] = d.size
 	if d.fr != nil {
 		runing["currentName"] = d.fr.Name()
 	}
+	stats := d.statsLocked()
+	runing["bytesWritten"] = stats.BytesWritten
+	runing["rotations"] = stats.Rotations
+	runing["purges"] = stats.Purges
+	runing["lastRotatedAt"] = stats.LastRotatedAt
 	return runing
 }
+
+// Stats reports cumulative bytes written, rotations performed, purges, and
+// the last-rotation timestamp since this fileout was created.
+func (d *fileout) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.statsLocked()
+}
+
+func (d *fileout) statsLocked() Stats {
+	return Stats{
+		BytesWritten:  atomic.LoadInt64(&d.bytesWritten),
+		Rotations:     atomic.LoadInt64(&d.rotations),
+		Purges:        atomic.LoadInt64(&d.purges),
+		LastRotatedAt: time.Unix(0, atomic.LoadInt64(&d.lastRotateNS)),
+	}
+}
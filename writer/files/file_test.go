@@ -0,0 +1,150 @@
+package fileout
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// memFS is a minimal in-memory FS fake used to drive enforceMaxBackups
+// without touching the real filesystem. Glob mirrors osFS/filepath.Glob
+// matching semantics (a trailing "*" wildcard also matches a ".gz" suffix),
+// so tests exercise the same double-counting hazard real globs would.
+type memFS struct {
+	modTimes map[string]time.Time
+	order    []string
+	removed  map[string]bool
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return nil, errors.New("memFS: OpenFile not supported by this fake")
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	if m.removed[name] {
+		return nil, os.ErrNotExist
+	}
+	mt, ok := m.modTimes[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return fakeFileInfo{modTime: mt}, nil
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error { return nil }
+
+func (m *memFS) Remove(name string) error {
+	if m.removed[name] {
+		return os.ErrNotExist
+	}
+	m.removed[name] = true
+	return nil
+}
+
+func (m *memFS) MkdirAll(path string, perm os.FileMode) error { return nil }
+
+func (m *memFS) Glob(pattern string) ([]string, error) {
+	var out []string
+	for _, name := range m.order {
+		if m.removed[name] {
+			continue
+		}
+		ok, err := filepath.Match(pattern, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+func (m *memFS) Symlink(oldname, newname string) error { return nil }
+
+type fakeFileInfo struct {
+	modTime time.Time
+}
+
+func (f fakeFileInfo) Name() string       { return "" }
+func (f fakeFileInfo) Size() int64        { return 0 }
+func (f fakeFileInfo) Mode() os.FileMode  { return 0 }
+func (f fakeFileInfo) ModTime() time.Time { return f.modTime }
+func (f fakeFileInfo) IsDir() bool        { return false }
+func (f fakeFileInfo) Sys() interface{}   { return nil }
+
+func TestEnforceMaxBackupsFIFOTies(t *testing.T) {
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	modTimes := map[string]time.Time{
+		"app.log.a": base,
+		"app.log.b": base,
+		"app.log.c": base,
+		"app.log.d": base.Add(time.Minute),
+	}
+
+	cases := []struct {
+		globOrder []string
+		wantGone  []string
+		wantLeft  []string
+	}{
+		// a, b, c tie at base; ties are evicted in the order Glob returned
+		// them (FIFO), so the first two of the tied group go first.
+		{globOrder: []string{"app.log.a", "app.log.b", "app.log.c", "app.log.d"}, wantGone: []string{"app.log.a", "app.log.b"}, wantLeft: []string{"app.log.c", "app.log.d"}},
+		{globOrder: []string{"app.log.c", "app.log.b", "app.log.a", "app.log.d"}, wantGone: []string{"app.log.c", "app.log.b"}, wantLeft: []string{"app.log.a", "app.log.d"}},
+	}
+
+	for _, tc := range cases {
+		fs := &memFS{modTimes: modTimes, order: tc.globOrder, removed: map[string]bool{}}
+		d := &fileout{opt: &Options{maxBackups: 2, fs: fs}}
+		if err := d.enforceMaxBackups("app.log.*"); err != nil {
+			t.Fatalf("enforceMaxBackups returned error: %s", err)
+		}
+
+		for _, n := range tc.wantGone {
+			if !fs.removed[n] {
+				t.Errorf("expected %s to be evicted for order %v, but it remains", n, tc.globOrder)
+			}
+		}
+		for _, n := range tc.wantLeft {
+			if fs.removed[n] {
+				t.Errorf("expected %s to remain for order %v, but it was removed", n, tc.globOrder)
+			}
+		}
+	}
+}
+
+// TestEnforceMaxBackupsDoesNotDoubleCountGz guards against globbing for
+// "pattern+.gz" in addition to "pattern": since pattern already ends in a
+// "*" wildcard that matches the ".gz" suffix, that second glob would list
+// every compressed backup twice and FIFO-evict past the real count.
+func TestEnforceMaxBackupsDoesNotDoubleCountGz(t *testing.T) {
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	modTimes := map[string]time.Time{
+		"app.log.a":    base,
+		"app.log.b.gz": base.Add(time.Minute),
+		"app.log.c.gz": base.Add(2 * time.Minute),
+		"app.log.d":    base.Add(3 * time.Minute),
+	}
+	order := []string{"app.log.a", "app.log.b.gz", "app.log.c.gz", "app.log.d"}
+
+	fs := &memFS{modTimes: modTimes, order: order, removed: map[string]bool{}}
+	d := &fileout{opt: &Options{maxBackups: 2, fs: fs}}
+	if err := d.enforceMaxBackups("app.log.*"); err != nil {
+		t.Fatalf("enforceMaxBackups returned error: %s", err)
+	}
+
+	wantGone := []string{"app.log.a", "app.log.b.gz"}
+	wantLeft := []string{"app.log.c.gz", "app.log.d"}
+	for _, n := range wantGone {
+		if !fs.removed[n] {
+			t.Errorf("expected %s to be evicted, but it remains", n)
+		}
+	}
+	for _, n := range wantLeft {
+		if fs.removed[n] {
+			t.Errorf("expected %s to remain within maxBackups=2, but it was removed", n)
+		}
+	}
+}
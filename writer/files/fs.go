@@ -0,0 +1,48 @@
+package fileout
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// File is the subset of *os.File operations fileout needs from a handle
+// returned by FS.OpenFile.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Name() string
+}
+
+// FS abstracts the filesystem operations fileout needs, so callers can swap
+// in an in-memory or non-local backend (afero-style, or an S3-backed FUSE
+// mount) without forking.
+type FS interface {
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Stat(name string) (os.FileInfo, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	MkdirAll(path string, perm os.FileMode) error
+	Glob(pattern string) ([]string, error)
+	Symlink(oldname, newname string) error
+}
+
+// osFS is the default FS, preserving fileout's historical direct-os.* behavior.
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+func (osFS) Rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
+
+func (osFS) Remove(name string) error { return os.Remove(name) }
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+
+func (osFS) Glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
+
+func (osFS) Symlink(oldname, newname string) error { return os.Symlink(oldname, newname) }
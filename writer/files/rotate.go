@@ -0,0 +1,182 @@
+package fileout
+
+import (
+	"time"
+)
+
+// RotateRule decides when the active log file must be rotated and what
+// happens to files left behind by previous rotations. Implementations are
+// expected to be safe for concurrent use, since getWriter may consult them
+// from the Write goroutine while stduffRun reads OutdatedFiles concurrently.
+type RotateRule interface {
+	// ShallRotate reports whether a file holding size bytes, as of now,
+	// must be rotated before accepting more writes.
+	ShallRotate(size int64, now time.Time) bool
+	// MarkRotated notifies the rule that a rotation just happened, so it
+	// can reset whatever bookkeeping ShallRotate relies on.
+	MarkRotated()
+	// OutdatedFiles returns the paths of rotated files this rule considers
+	// past their retention policy and safe to delete.
+	OutdatedFiles() []string
+}
+
+// outdatedByGlob lists the files matching pattern whose mtime is older than
+// keepDays, read through fsys instead of the real OS so a WithFS backend
+// (in-memory, afero, a non-local mount) sees the same files stduffHandler
+// will purge through that same FS. keepDays <= 0 disables the check. fsys
+// defaults to osFS when nil, so a RotateRule built outside of NewFileout
+// keeps its old behavior.
+func outdatedByGlob(fsys FS, pattern string, keepDays int) []string {
+	if pattern == "" || keepDays <= 0 {
+		return nil
+	}
+	if fsys == nil {
+		fsys = osFS{}
+	}
+	matches, err := fsys.Glob(pattern)
+	if err != nil {
+		return nil
+	}
+	cutoff := time.Now().Add(-time.Duration(keepDays) * 24 * time.Hour)
+	var outdated []string
+	for _, m := range matches {
+		fi, err := fsys.Stat(m)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		if fi.ModTime().Before(cutoff) {
+			outdated = append(outdated, m)
+		}
+	}
+	return outdated
+}
+
+// SizeRotateRule rotates once the active file would exceed maxSizeMB.
+type SizeRotateRule struct {
+	fs        FS
+	pattern   string
+	keepDays  int
+	maxSizeMB int
+}
+
+// NewSizeRotateRule builds a SizeRotateRule, using pattern to find siblings
+// eligible for OutdatedFiles, read through fs (the same FS the owning
+// fileout writes through).
+func NewSizeRotateRule(fs FS, pattern string, keepDays, maxSizeMB int) *SizeRotateRule {
+	return &SizeRotateRule{fs: fs, pattern: pattern, keepDays: keepDays, maxSizeMB: maxSizeMB}
+}
+
+func (r *SizeRotateRule) maxBytes() int64 {
+	if r.maxSizeMB <= 0 {
+		return int64(defaultMaxSize * megabyte)
+	}
+	return int64(r.maxSizeMB) * int64(megabyte)
+}
+
+func (r *SizeRotateRule) ShallRotate(size int64, _ time.Time) bool {
+	return size > r.maxBytes()
+}
+
+func (r *SizeRotateRule) MarkRotated() {}
+
+func (r *SizeRotateRule) OutdatedFiles() []string {
+	return outdatedByGlob(r.fs, r.pattern, r.keepDays)
+}
+
+// DailyRotateRule rotates once the wall-clock date changes.
+type DailyRotateRule struct {
+	fs       FS
+	pattern  string
+	keepDays int
+	last     time.Time
+}
+
+// NewDailyRotateRule builds a DailyRotateRule, reading siblings for
+// OutdatedFiles through fs.
+func NewDailyRotateRule(fs FS, pattern string, keepDays int) *DailyRotateRule {
+	return &DailyRotateRule{fs: fs, pattern: pattern, keepDays: keepDays, last: time.Now()}
+}
+
+func (r *DailyRotateRule) ShallRotate(_ int64, now time.Time) bool {
+	return now.Year() != r.last.Year() || now.YearDay() != r.last.YearDay()
+}
+
+func (r *DailyRotateRule) MarkRotated() {
+	r.last = time.Now()
+}
+
+func (r *DailyRotateRule) OutdatedFiles() []string {
+	return outdatedByGlob(r.fs, r.pattern, r.keepDays)
+}
+
+// DurationRotateRule rotates every interval, regardless of size.
+type DurationRotateRule struct {
+	fs       FS
+	pattern  string
+	keepDays int
+	interval time.Duration
+	last     time.Time
+}
+
+// NewDurationRotateRule builds a DurationRotateRule, reading siblings for
+// OutdatedFiles through fs.
+func NewDurationRotateRule(fs FS, pattern string, keepDays int, interval time.Duration) *DurationRotateRule {
+	return &DurationRotateRule{fs: fs, pattern: pattern, keepDays: keepDays, interval: interval, last: time.Now()}
+}
+
+func (r *DurationRotateRule) ShallRotate(_ int64, now time.Time) bool {
+	if r.interval <= 0 {
+		return false
+	}
+	return now.Sub(r.last) >= r.interval
+}
+
+func (r *DurationRotateRule) MarkRotated() {
+	r.last = time.Now()
+}
+
+func (r *DurationRotateRule) OutdatedFiles() []string {
+	return outdatedByGlob(r.fs, r.pattern, r.keepDays)
+}
+
+// compositeRotateRule rotates when any of its rules would, mirroring the
+// historical maxSize-or-rotationTime behavior used before RotateRule
+// existed.
+type compositeRotateRule struct {
+	rules []RotateRule
+}
+
+func (c *compositeRotateRule) ShallRotate(size int64, now time.Time) bool {
+	for _, r := range c.rules {
+		if r.ShallRotate(size, now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compositeRotateRule) MarkRotated() {
+	for _, r := range c.rules {
+		r.MarkRotated()
+	}
+}
+
+func (c *compositeRotateRule) OutdatedFiles() []string {
+	var outdated []string
+	for _, r := range c.rules {
+		outdated = append(outdated, r.OutdatedFiles()...)
+	}
+	return outdated
+}
+
+// defaultRotateRule builds the rule equivalent to the options' WithMaxSize
+// and WithRotationTime, used whenever WithRotateRule isn't supplied. The
+// rules it builds read through o.fs, so NewFileout must default o.fs before
+// calling this.
+func defaultRotateRule(pattern string, o *Options) RotateRule {
+	rules := []RotateRule{NewSizeRotateRule(o.fs, pattern, o.maxAge, o.maxSize)}
+	if o.rotationTime > 0 {
+		rules = append(rules, NewDurationRotateRule(o.fs, pattern, o.maxAge, o.rotationTime*time.Minute))
+	}
+	return &compositeRotateRule{rules: rules}
+}